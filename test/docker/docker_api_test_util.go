@@ -22,24 +22,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
-	"regexp"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/api/types/volume"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 )
 
@@ -68,9 +61,42 @@ func coverageDir(t *testing.T) string {
 	return filepath.Join(dir, "coverage")
 }
 
+// BindOpts controls how withBindMount labels a bind mount for SELinux.
+type BindOpts struct {
+	// Private requests a private (:Z) relabel instead of the default
+	// shared (:z) relabel. Use this for volumes that shouldn't be
+	// readable by other containers, e.g. a queue manager's own data.
+	Private bool
+}
+
+// seLinuxLabel returns the SELinux label suffix ("z" or "Z") to append to a
+// bind mount, or "" if TEST_SELINUX_LABEL is not set. On SELinux-enforcing
+// hosts the container process otherwise can't read/write bind-mounted host
+// paths, because they don't carry a matching context.
+func seLinuxLabel(opts BindOpts) string {
+	if os.Getenv("TEST_SELINUX_LABEL") == "" {
+		return ""
+	}
+	if opts.Private {
+		return "Z"
+	}
+	return "z"
+}
+
+// withBindMount builds a Docker bind string ("host:ctr"), optionally
+// suffixed with an SELinux relabel option, as selected by opts and the
+// TEST_SELINUX_LABEL environment variable.
+func withBindMount(host, ctr string, opts BindOpts) string {
+	bind := host + ":" + ctr
+	if label := seLinuxLabel(opts); label != "" {
+		bind += ":" + label
+	}
+	return bind
+}
+
 // coverageBind returns a string to use to add a bind-mounted directory for code coverage data
 func coverageBind(t *testing.T) string {
-	return coverageDir(t) + ":/var/coverage"
+	return withBindMount(coverageDir(t), "/var/coverage", BindOpts{})
 }
 
 // terminationLog returns the name of the file to use for the termination log message
@@ -92,7 +118,7 @@ func terminationBind(t *testing.T) string {
 		t.Fatal(err)
 	}
 	f.Close()
-	return n + ":/dev/termination-log"
+	return withBindMount(n, "/dev/termination-log", BindOpts{})
 }
 
 // Returns the termination message, or an empty string if not set
@@ -111,7 +137,7 @@ func expectTerminationMessage(t *testing.T) {
 	}
 }
 
-func cleanContainer(t *testing.T, cli *client.Client, ID string) {
+func cleanContainer(t *testing.T, cli Runtime, ID string) {
 	i, err := cli.ContainerInspect(context.Background(), ID)
 	if err == nil {
 		// Log the results and continue
@@ -157,7 +183,7 @@ func cleanContainer(t *testing.T, cli *client.Client, ID string) {
 // runContainer creates and starts a container.  If no image is specified in
 // the container config, then the image name is retrieved from the TEST_IMAGE
 // environment variable.
-func runContainer(t *testing.T, cli *client.Client, containerConfig *container.Config) string {
+func runContainer(t *testing.T, cli Runtime, containerConfig *container.Config) string {
 	if containerConfig.Image == "" {
 		containerConfig.Image = imageName()
 	}
@@ -180,15 +206,15 @@ func runContainer(t *testing.T, cli *client.Client, containerConfig *container.C
 	}
 	networkingConfig := network.NetworkingConfig{}
 	t.Logf("Running container (%s)", containerConfig.Image)
-	ctr, err := cli.ContainerCreate(context.Background(), containerConfig, &hostConfig, &networkingConfig, t.Name())
+	ID, err := cli.ContainerCreate(context.Background(), containerConfig, &hostConfig, &networkingConfig, t.Name())
 	if err != nil {
 		t.Fatal(err)
 	}
-	startContainer(t, cli, ctr.ID)
-	return ctr.ID
+	startContainer(t, cli, ID)
+	return ID
 }
 
-func runContainerOneShot(t *testing.T, cli *client.Client, command ...string) (int64, string) {
+func runContainerOneShot(t *testing.T, cli Runtime, command ...string) (int64, string) {
 	containerConfig := container.Config{
 		Entrypoint: command,
 	}
@@ -197,16 +223,15 @@ func runContainerOneShot(t *testing.T, cli *client.Client, command ...string) (i
 	return waitForContainer(t, cli, id, 10), inspectLogs(t, cli, id)
 }
 
-func startContainer(t *testing.T, cli *client.Client, ID string) {
+func startContainer(t *testing.T, cli Runtime, ID string) {
 	t.Logf("Starting container: %v", ID)
-	startOptions := types.ContainerStartOptions{}
-	err := cli.ContainerStart(context.Background(), ID, startOptions)
+	err := cli.ContainerStart(context.Background(), ID)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
-func stopContainer(t *testing.T, cli *client.Client, ID string) {
+func stopContainer(t *testing.T, cli Runtime, ID string) {
 	t.Logf("Stopping container: %v", ID)
 	timeout := 10 * time.Second
 	err := cli.ContainerStop(context.Background(), ID, &timeout) //Duration(20)*time.Second)
@@ -239,7 +264,7 @@ func getCoverageExitCode(t *testing.T, orig int64) int64 {
 }
 
 // waitForContainer waits until a container has exited
-func waitForContainer(t *testing.T, cli *client.Client, ID string, timeout int64) int64 {
+func waitForContainer(t *testing.T, cli Runtime, ID string, timeout int64) int64 {
 	rc, err := cli.ContainerWait(context.Background(), ID)
 
 	if coverage() {
@@ -256,73 +281,24 @@ func waitForContainer(t *testing.T, cli *client.Client, ID string, timeout int64
 }
 
 // execContainer runs a command in a running container, and returns the exit code and output
-func execContainer(t *testing.T, cli *client.Client, ID string, user string, cmd []string) (int, string) {
-	rerun:
-	config := types.ExecConfig{
-		User:        user,
-		Privileged:  false,
-		Tty:         false,
-		AttachStdin: false,
-		// Note that you still need to attach stdout/stderr, even though they're not wanted
-		AttachStdout: true,
-		AttachStderr: true,
-		Detach:       false,
-		Cmd:          cmd,
-	}
-	resp, err := cli.ContainerExecCreate(context.Background(), ID, config)
-	if err != nil {
-		t.Fatal(err)
-	}
-	hijack, err := cli.ContainerExecAttach(context.Background(), resp.ID, config)
+func execContainer(t *testing.T, cli Runtime, ID string, user string, cmd []string) (int, string) {
+	exitcode, out, err := cli.ContainerExec(context.Background(), ID, user, cmd)
 	if err != nil {
 		t.Fatal(err)
 	}
-	cli.ContainerExecStart(context.Background(), resp.ID, types.ExecStartCheck{
-		Detach: false,
-		Tty:    false,
-	})
-	// Wait for the command to finish
-	var exitcode int
-	for {
-		inspect, err := cli.ContainerExecInspect(context.Background(), resp.ID)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if !inspect.Running {
-			exitcode = inspect.ExitCode
-			break
-		}
-	}
-	buf := new(bytes.Buffer)
-	// Each output line has a header, which needs to be removed
-	_, err = stdcopy.StdCopy(buf, buf, hijack.Reader)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	outputStr := strings.TrimSpace(buf.String())
-
-	// Before we go let's just double check it did actually run because sometimes we get a "Exec command already running error"
-	alreadyRunningErr := regexp.MustCompile("Error: Exec command .* is already running")
-	if alreadyRunningErr.MatchString(outputStr) {
-		time.Sleep(1 * time.Second)
-		goto rerun
-	}
-
-	return exitcode, outputStr
+	return exitcode, out
 }
 
-func waitForReady(t *testing.T, cli *client.Client, ID string) {
-	for {
-		rc, _ := execContainer(t, cli, ID, "mqm", []string{"chkmqready"})
-		if rc == 0 {
-			t.Log("MQ is ready")
-			return
-		}
+func waitForReady(t *testing.T, cli Runtime, ID string) {
+	stream := newMQLogStream(t, cli, ID)
+	_, err := stream.WaitFor(`(?i)AMQ5806I|queue manager.*started`, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
 	}
+	t.Log("MQ is ready")
 }
 
-func getIPAddress(t *testing.T, cli *client.Client, ID string) string {
+func getIPAddress(t *testing.T, cli Runtime, ID string) string {
 	ctr, err := cli.ContainerInspect(context.Background(), ID)
 	if err != nil {
 		t.Fatal(err)
@@ -330,19 +306,18 @@ func getIPAddress(t *testing.T, cli *client.Client, ID string) string {
 	return ctr.NetworkSettings.IPAddress
 }
 
-func createNetwork(t *testing.T, cli *client.Client) string {
+func createNetwork(t *testing.T, cli Runtime) string {
 	name := "test"
 	t.Logf("Creating network: %v", name)
-	opts := types.NetworkCreate{}
-	net, err := cli.NetworkCreate(context.Background(), name, opts)
+	ID, err := cli.NetworkCreate(context.Background(), name)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("Created network %v with ID %v", name, net.ID)
-	return net.ID
+	t.Logf("Created network %v with ID %v", name, ID)
+	return ID
 }
 
-func removeNetwork(t *testing.T, cli *client.Client, ID string) {
+func removeNetwork(t *testing.T, cli Runtime, ID string) {
 	t.Logf("Removing network ID: %v", ID)
 	err := cli.NetworkRemove(context.Background(), ID)
 	if err != nil {
@@ -350,29 +325,29 @@ func removeNetwork(t *testing.T, cli *client.Client, ID string) {
 	}
 }
 
-func createVolume(t *testing.T, cli *client.Client) types.Volume {
-	v, err := cli.VolumeCreate(context.Background(), volume.VolumesCreateBody{
-		Driver:     "local",
-		DriverOpts: map[string]string{},
-		Labels:     map[string]string{},
-		Name:       t.Name(),
-	})
+// createVolume creates an anonymous named volume. Unlike bind mounts, the
+// local volume driver's "o" option only takes effect alongside type/device
+// (i.e. when the volume is itself backed by a bind mount), and doesn't
+// accept a bare "z"/"Z" token, so there's no SELinux-relabelling
+// equivalent of withBindMount for volumes created this way.
+func createVolume(t *testing.T, cli Runtime) types.Volume {
+	err := cli.VolumeCreate(context.Background(), t.Name())
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Logf("Created volume %v", t.Name())
-	return v
+	return types.Volume{Name: t.Name()}
 }
 
-func removeVolume(t *testing.T, cli *client.Client, name string) {
+func removeVolume(t *testing.T, cli Runtime, name string) {
 	t.Logf("Removing volume %v", name)
-	err := cli.VolumeRemove(context.Background(), name, true)
+	err := cli.VolumeRemove(context.Background(), name)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
-func inspectTextLogs(t *testing.T, cli *client.Client, ID string) string {
+func inspectTextLogs(t *testing.T, cli Runtime, ID string) string {
 	jsonLogs := inspectLogs(t, cli, ID)
 	scanner := bufio.NewScanner(strings.NewReader(jsonLogs))
 	b := make([]byte, 64*1024)
@@ -395,23 +370,14 @@ func inspectTextLogs(t *testing.T, cli *client.Client, ID string) string {
 	return buf.String()
 }
 
-func inspectLogs(t *testing.T, cli *client.Client, ID string) string {
+func inspectLogs(t *testing.T, cli Runtime, ID string) string {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	reader, err := cli.ContainerLogs(ctx, ID, types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-	buf := new(bytes.Buffer)
-	// Each output line has a header, which needs to be removed
-	_, err = stdcopy.StdCopy(buf, buf, reader)
+	out, err := cli.ContainerLogs(ctx, ID)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
-	return buf.String()
+	return out
 }
 
 // generateTAR creates a TAR-formatted []byte, with the specified files included.
@@ -441,45 +407,23 @@ func generateTAR(t *testing.T, files []struct{ Name, Body string }) []byte {
 }
 
 // createImage creates a new Docker image with the specified files included.
-func createImage(t *testing.T, cli *client.Client, files []struct{ Name, Body string }) string {
+func createImage(t *testing.T, cli Runtime, files []struct{ Name, Body string }) string {
 	r := bytes.NewReader(generateTAR(t, files))
 	tag := strings.ToLower(t.Name())
-	buildOptions := types.ImageBuildOptions{
-		Context: r,
-		Tags:    []string{tag},
-	}
-	resp, err := cli.ImageBuild(context.Background(), r, buildOptions)
+	err := cli.ImageBuild(context.Background(), r, tag)
 	if err != nil {
 		t.Fatal(err)
 	}
-	// resp (ImageBuildResponse) contains a series of JSON messages
-	dec := json.NewDecoder(resp.Body)
-	for {
-		m := jsonmessage.JSONMessage{}
-		err := dec.Decode(&m)
-		if m.Error != nil {
-			t.Fatal(m.ErrorMessage)
-		}
-		t.Log(strings.TrimSpace(m.Stream))
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
 	return tag
 }
 
 // deleteImage deletes a Docker image
-func deleteImage(t *testing.T, cli *client.Client, id string) {
-	cli.ImageRemove(context.Background(), id, types.ImageRemoveOptions{
-		Force: true,
-	})
+func deleteImage(t *testing.T, cli Runtime, id string) {
+	cli.ImageRemove(context.Background(), id)
 }
 
-func copyFromContainer(t *testing.T, cli *client.Client, id string, file string) []byte {
-	reader, _, err := cli.CopyFromContainer(context.Background(), id, file)
+func copyFromContainer(t *testing.T, cli Runtime, id string, file string) []byte {
+	reader, err := cli.CopyFromContainer(context.Background(), id, file)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -491,7 +435,7 @@ func copyFromContainer(t *testing.T, cli *client.Client, id string, file string)
 	return b
 }
 
-func getWebPort(t *testing.T, cli *client.Client, ID string) string {
+func getWebPort(t *testing.T, cli Runtime, ID string) string {
 	i, err := cli.ContainerInspect(context.Background(), ID)
 	if err != nil {
 		t.Fatal(err)
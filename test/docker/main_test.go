@@ -0,0 +1,40 @@
+/*
+© Copyright IBM Corporation 2017, 2018
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"testing"
+)
+
+// TestMain pulls TEST_IMAGE from TEST_REGISTRY_MIRROR (if set) once, before
+// any test runs, so a fresh CI host doesn't need a manual `docker pull`/
+// `podman pull` first.
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	cli, err := newRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := pullTestImage(cli); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,166 @@
+/*
+© Copyright IBM Corporation 2017, 2018
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// MQLogEntry is one structured log record, as emitted by the queue manager
+// in the mqjson format.
+type MQLogEntry struct {
+	Time     time.Time
+	Host     string
+	Message  string
+	Severity string
+	Ident    string
+	QMgr     string
+	Arith    []string
+}
+
+// mqLogEntryFields mirrors the subset of mqjson fields that map directly
+// onto MQLogEntry. The ibm_arithInsertN fields are variable in number, so
+// they're collected separately in UnmarshalJSON.
+type mqLogEntryFields struct {
+	Time     string `json:"ibm_datetime"`
+	Host     string `json:"host"`
+	Message  string `json:"message"`
+	Severity string `json:"loglevel"`
+	Ident    string `json:"ibm_messageId"`
+	QMgr     string `json:"ibm_qmgr"`
+}
+
+// UnmarshalJSON decodes a single mqjson log line into an MQLogEntry.
+func (e *MQLogEntry) UnmarshalJSON(b []byte) error {
+	var fields mqLogEntryFields
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	e.Host = fields.Host
+	e.Message = fields.Message
+	e.Severity = fields.Severity
+	e.Ident = fields.Ident
+	e.QMgr = fields.QMgr
+	e.Arith = nil
+
+	if fields.Time != "" {
+		if ts, err := time.Parse(time.RFC3339Nano, fields.Time); err == nil {
+			e.Time = ts
+		}
+	}
+	for i := 1; ; i++ {
+		v, ok := raw[fmt.Sprintf("ibm_arithInsert%d", i)]
+		if !ok {
+			break
+		}
+		e.Arith = append(e.Arith, fmt.Sprintf("%v", v))
+	}
+	return nil
+}
+
+// MQLogLine is one line of container output: either a parsed MQLogEntry, or
+// a RawLine for anything that isn't valid mqjson.
+type MQLogLine struct {
+	Entry   *MQLogEntry
+	RawLine string
+}
+
+// MQLogStream reads and parses a container's console output as a sequence
+// of mqjson log entries.
+type MQLogStream struct {
+	t   *testing.T
+	cli Runtime
+	id  string
+}
+
+// newMQLogStream returns a stream over the console output of container id.
+func newMQLogStream(t *testing.T, cli Runtime, id string) *MQLogStream {
+	return &MQLogStream{t: t, cli: cli, id: id}
+}
+
+// lines re-reads the container's current console output and parses it.
+func (s *MQLogStream) lines() []MQLogLine {
+	text := inspectLogs(s.t, s.cli, s.id)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	buf := make([]byte, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+	var out []MQLogLine
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "{") {
+			var e MQLogEntry
+			if err := json.Unmarshal([]byte(line), &e); err == nil {
+				out = append(out, MQLogLine{Entry: &e})
+				continue
+			}
+		}
+		out = append(out, MQLogLine{RawLine: line})
+	}
+	return out
+}
+
+// Filter returns every parsed log entry for which pred returns true.
+// Non-JSON (RawLine) lines are never passed to pred.
+func (s *MQLogStream) Filter(pred func(e MQLogEntry) bool) []MQLogEntry {
+	var out []MQLogEntry
+	for _, l := range s.lines() {
+		if l.Entry != nil && pred(*l.Entry) {
+			out = append(out, *l.Entry)
+		}
+	}
+	return out
+}
+
+// WaitFor polls the container's console output until a log entry's Message
+// matches pattern, or timeout elapses.
+func (s *MQLogStream) WaitFor(pattern string, timeout time.Duration) (MQLogEntry, error) {
+	re := regexp.MustCompile(pattern)
+	deadline := time.Now().Add(timeout)
+	for {
+		matches := s.Filter(func(e MQLogEntry) bool {
+			return re.MatchString(e.Message)
+		})
+		if len(matches) > 0 {
+			return matches[0], nil
+		}
+		if time.Now().After(deadline) {
+			return MQLogEntry{}, fmt.Errorf("timed out after %v waiting for log entry matching %q", timeout, pattern)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// AssertNoErrors fails t if any AMQ error-severity entry is present in the
+// console output so far.
+func (s *MQLogStream) AssertNoErrors(t *testing.T) {
+	errs := s.Filter(func(e MQLogEntry) bool {
+		return e.Severity == "ERROR" || strings.HasSuffix(e.Ident, "E")
+	})
+	for _, e := range errs {
+		t.Errorf("Unexpected error in MQ log (%v): %v", e.Ident, e.Message)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+© Copyright IBM Corporation 2017, 2018
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+// poolSizeFlag controls how many queue-manager containers ContainerPool
+// pre-warms. It defaults to not pooling at all, so existing tests that
+// create their own containers are unaffected. It's registered here (rather
+// than in TestMain) so it's parsed the same way regardless of whether
+// TestMain calls flag.Parse() itself, but its value is only consumed once
+// a test calls SharedPool.
+var poolSizeFlag = flag.Int("pool-size", 0, "number of queue manager containers to pre-warm for ContainerPool")
+
+var (
+	sharedPoolOnce sync.Once
+	sharedPool     *ContainerPool
+)
+
+// SharedPool returns the process-wide ContainerPool sized by -pool-size,
+// building it on the first call. It returns nil if -pool-size is 0 or
+// unset, meaning pooling is disabled.
+//
+// This can't be built from TestMain, which only has a *testing.M, and
+// NewContainerPool needs a *testing.T to log against and fail via. So
+// instead, the first test that wants a pooled container builds it here.
+func SharedPool(t *testing.T, cli Runtime) *ContainerPool {
+	if *poolSizeFlag <= 0 {
+		return nil
+	}
+	sharedPoolOnce.Do(func() {
+		sharedPool = NewContainerPool(t, cli, *poolSizeFlag)
+	})
+	return sharedPool
+}
+
+// PooledContainer is a queue-manager container owned by a ContainerPool.
+// Unlike the containers created by runContainer, its termination log path
+// and host port are fixed for the lifetime of the container (not the
+// lifetime of a single test), so that the pool can safely hand the same
+// container out to a sequence of parallel tests.
+type PooledContainer struct {
+	ID              string
+	terminationPath string
+	hostPort        string
+	tainted         bool
+}
+
+// Taint marks the container as dirtied by the current test, so Release
+// discards it (and the pool starts a replacement) instead of resetting and
+// reusing it.
+func (p *PooledContainer) Taint() {
+	p.tainted = true
+}
+
+// HostPort returns the host port bound to the container's 9443/tcp web
+// server port.
+func (p *PooledContainer) HostPort() string {
+	return p.hostPort
+}
+
+// TerminationMessage returns the contents of this container's termination
+// log, or an empty string if it hasn't written one.
+func (p *PooledContainer) TerminationMessage() string {
+	b, err := ioutil.ReadFile(p.terminationPath)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// ContainerPool pre-warms a fixed number of queue-manager containers and
+// hands them out to tests, so that tests don't each pay MQ's 5-20s startup
+// cost. Acquire/Release are safe to call from parallel tests: the pool's
+// channel buffer bounds concurrency to its size.
+type ContainerPool struct {
+	cli   Runtime
+	size  int
+	items chan *PooledContainer
+
+	idxMu   sync.Mutex
+	nextIdx int
+}
+
+// NewContainerPool creates a pool of size queue-manager containers, each
+// built from the canonical (no extra config) image returned by imageName().
+func NewContainerPool(t *testing.T, cli Runtime, size int) *ContainerPool {
+	p := &ContainerPool{
+		cli:   cli,
+		size:  size,
+		items: make(chan *PooledContainer, size),
+	}
+	for i := 0; i < size; i++ {
+		p.items <- p.newContainer(t)
+	}
+	return p
+}
+
+func (p *ContainerPool) newContainer(t *testing.T) *PooledContainer {
+	p.idxMu.Lock()
+	idx := p.nextIdx
+	p.nextIdx++
+	p.idxMu.Unlock()
+
+	name := fmt.Sprintf("pool-%d-%d", os.Getpid(), idx)
+	terminationPath := filepath.Join(os.TempDir(), name+"-termination-log")
+	os.Remove(terminationPath)
+	f, err := os.OpenFile(terminationPath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	containerConfig := container.Config{
+		Image: imageName(),
+	}
+	hostConfig := container.HostConfig{
+		Binds: []string{
+			withBindMount(terminationPath, "/dev/termination-log", BindOpts{}),
+		},
+		// Let the daemon assign a host port per pooled container, so
+		// N pooled queue managers can run (and be acquired by parallel
+		// tests) at once without colliding on 9443/tcp.
+		PortBindings: nat.PortMap{
+			"9443/tcp": []nat.PortBinding{
+				{HostIP: "0.0.0.0"},
+			},
+		},
+	}
+	networkingConfig := network.NetworkingConfig{}
+	t.Logf("Pool: starting container %v", name)
+	ID, err := p.cli.ContainerCreate(context.Background(), &containerConfig, &hostConfig, &networkingConfig, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.cli.ContainerStart(context.Background(), ID); err != nil {
+		t.Fatal(err)
+	}
+
+	pc := &PooledContainer{ID: ID, terminationPath: terminationPath}
+	waitForPooledReady(t, p.cli, pc)
+	pc.hostPort = getWebPort(t, p.cli, ID)
+	return pc
+}
+
+func waitForPooledReady(t *testing.T, cli Runtime, pc *PooledContainer) {
+	stream := newMQLogStream(t, cli, pc.ID)
+	if _, err := stream.WaitFor(`(?i)AMQ5806I|queue manager.*started`, 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Acquire takes a container from the pool, blocking until one is
+// available. The caller must call Release when done with it.
+func (p *ContainerPool) Acquire(t *testing.T) *PooledContainer {
+	return <-p.items
+}
+
+// Release returns a container to the pool. If the test tainted it, the
+// container is discarded and replaced with a freshly warmed one;
+// otherwise its queue manager is reset (user queues deleted, messages
+// purged) so the next Acquire gets a clean instance.
+func (p *ContainerPool) Release(t *testing.T, pc *PooledContainer) {
+	if pc.tainted {
+		t.Log("Pool: discarding tainted container")
+		p.discard(t, pc)
+		p.items <- p.newContainer(t)
+		return
+	}
+	p.reset(t, pc)
+	p.items <- pc
+}
+
+func (p *ContainerPool) discard(t *testing.T, pc *PooledContainer) {
+	timeout := 10 * time.Second
+	if err := p.cli.ContainerStop(context.Background(), pc.ID, &timeout); err != nil {
+		t.Log(err)
+	}
+	opts := types.ContainerRemoveOptions{RemoveVolumes: true, Force: true}
+	if err := p.cli.ContainerRemove(context.Background(), pc.ID, opts); err != nil {
+		t.Log(err)
+	}
+	os.Remove(pc.terminationPath)
+}
+
+// resetScript purges and deletes every local queue a test may have
+// created, without touching the SYSTEM.* queues the queue manager itself
+// depends on.
+const resetScript = `set -eu
+queues=$(printf 'DISPLAY QLOCAL(*) NAME\n' | runmqsc | sed -n "s/.*QUEUE(\([^)]*\)).*/\1/p" | grep -v '^SYSTEM\.' || true)
+for q in $queues; do
+	printf 'CLEAR QLOCAL(%s) PURGE\nDELETE QLOCAL(%s)\n' "$q" "$q" | runmqsc
+done
+`
+
+// reset clears out any user queues (and the messages on them) a test may
+// have left behind, so the container can be handed to the next test
+// unchanged. SYSTEM.* queues are left alone, since the queue manager
+// depends on them.
+func (p *ContainerPool) reset(t *testing.T, pc *PooledContainer) {
+	rc, out := execContainer(t, p.cli, pc.ID, "mqm", []string{"bash", "-c", resetScript})
+	if rc != 0 {
+		t.Errorf("Pool: reset of container %v failed (rc %v): %v", pc.ID, rc, out)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+© Copyright IBM Corporation 2017, 2018
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/docker/docker/api/types"
+)
+
+// pullTestImage pulls imageName() from TEST_REGISTRY_MIRROR, if set, so a
+// fresh CI host doesn't need a manual `docker pull` before the suite runs.
+// If TEST_REGISTRY_MIRROR isn't set, it does nothing and the image is
+// assumed to already be present locally, as before.
+//
+// It returns an error rather than taking a *testing.T, because it's meant
+// to be called once from TestMain, before any test (and its *testing.T)
+// exists.
+func pullTestImage(cli Runtime) error {
+	mirror := os.Getenv("TEST_REGISTRY_MIRROR")
+	if mirror == "" {
+		return nil
+	}
+	ref := mirror + "/" + imageName()
+	auth, err := registryAuth()
+	if err != nil {
+		return err
+	}
+	log.Printf("Pulling image %v", ref)
+	if err := cli.ImagePull(context.Background(), ref, auth); err != nil {
+		return err
+	}
+	// runContainer and friends create containers against imageName(), not
+	// the mirror-qualified ref, so the pulled image needs to be retagged
+	// under that name for them to find it.
+	return cli.ImageTag(context.Background(), ref, imageName())
+}
+
+// registryAuth builds the base64-encoded X-Registry-Auth payload for a
+// pull, from TEST_REGISTRY_USER/TEST_REGISTRY_PASSWORD or, failing that, a
+// docker credential helper named by TEST_REGISTRY_CREDS_STORE. It returns
+// "" if none of those are set, for an anonymous pull.
+func registryAuth() (string, error) {
+	user := os.Getenv("TEST_REGISTRY_USER")
+	pass := os.Getenv("TEST_REGISTRY_PASSWORD")
+	store := os.Getenv("TEST_REGISTRY_CREDS_STORE")
+
+	if user == "" && store != "" {
+		var err error
+		user, pass, err = credStoreAuth(store, os.Getenv("TEST_REGISTRY_MIRROR"))
+		if err != nil {
+			return "", err
+		}
+	}
+	if user == "" {
+		return "", nil
+	}
+
+	authConfig := types.AuthConfig{
+		Username:      user,
+		Password:      pass,
+		ServerAddress: os.Getenv("TEST_REGISTRY_MIRROR"),
+	}
+	b, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+// credStoreAuth looks up credentials for server using a docker credential
+// helper (e.g. TEST_REGISTRY_CREDS_STORE=osxkeychain invokes
+// docker-credential-osxkeychain), following the protocol described at
+// https://github.com/docker/docker-credential-helpers.
+func credStoreAuth(store, server string) (user, pass string, err error) {
+	helper := "docker-credential-" + store
+	cmd := exec.Command(helper, "get")
+	cmd.Stdin = bytes.NewBufferString(server)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", "", fmt.Errorf("%s get: %v", helper, err)
+	}
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", fmt.Errorf("%s get: %v", helper, err)
+	}
+	return creds.Username, creds.Secret, nil
+}
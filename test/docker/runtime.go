@@ -0,0 +1,76 @@
+/*
+© Copyright IBM Corporation 2017, 2018
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// Runtime captures the subset of the Docker API that the test suite
+// depends on, so that it can be satisfied by something other than a real
+// Docker daemon (e.g. Podman).  The set of methods here is deliberately
+// kept to what runContainer/execContainer/inspectLogs/createImage/
+// createVolume/createNetwork and friends actually use.
+type Runtime interface {
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (string, error)
+	ContainerStart(ctx context.Context, id string) error
+	ContainerStop(ctx context.Context, id string, timeout *time.Duration) error
+	ContainerWait(ctx context.Context, id string) (int64, error)
+	ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error)
+	ContainerRemove(ctx context.Context, id string, opts types.ContainerRemoveOptions) error
+	ContainerLogs(ctx context.Context, id string) (string, error)
+	ContainerExec(ctx context.Context, id string, user string, cmd []string) (int, string, error)
+	CopyFromContainer(ctx context.Context, id string, srcPath string) (io.ReadCloser, error)
+
+	ImageBuild(ctx context.Context, buildContext io.Reader, tag string) error
+	ImageRemove(ctx context.Context, id string) error
+	// ImagePull pulls ref, authenticating with auth if non-empty. auth is
+	// the base64-encoded Docker AuthConfig JSON produced by registryAuth();
+	// implementations that don't talk to the Docker API directly (e.g.
+	// podmanRuntime) are responsible for decoding it into whatever form
+	// their own tooling expects.
+	ImagePull(ctx context.Context, ref string, auth string) error
+	// ImageTag adds the tag target to the image already known as source.
+	ImageTag(ctx context.Context, source string, target string) error
+
+	NetworkCreate(ctx context.Context, name string) (string, error)
+	NetworkRemove(ctx context.Context, id string) error
+
+	VolumeCreate(ctx context.Context, name string) error
+	VolumeRemove(ctx context.Context, name string) error
+}
+
+// newRuntime selects a Runtime implementation based on the TEST_RUNTIME
+// environment variable.  It defaults to Docker, which keeps the existing
+// behaviour for anyone not opting in to Podman.
+func newRuntime() (Runtime, error) {
+	switch os.Getenv("TEST_RUNTIME") {
+	case "", "docker":
+		return newDockerRuntime()
+	case "podman":
+		return newPodmanRuntime()
+	default:
+		return nil, fmt.Errorf("unknown TEST_RUNTIME %q (expected \"docker\" or \"podman\")", os.Getenv("TEST_RUNTIME"))
+	}
+}
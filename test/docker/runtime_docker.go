@@ -0,0 +1,244 @@
+/*
+© Copyright IBM Corporation 2017, 2018
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// dockerRuntime implements Runtime on top of the real Docker daemon.
+type dockerRuntime struct {
+	cli *client.Client
+}
+
+func newDockerRuntime() (Runtime, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	return &dockerRuntime{cli: cli}, nil
+}
+
+func (d *dockerRuntime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (string, error) {
+	ctr, err := d.cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, containerName)
+	if err != nil {
+		return "", err
+	}
+	return ctr.ID, nil
+}
+
+func (d *dockerRuntime) ContainerStart(ctx context.Context, id string) error {
+	return d.cli.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+func (d *dockerRuntime) ContainerStop(ctx context.Context, id string, timeout *time.Duration) error {
+	return d.cli.ContainerStop(ctx, id, timeout)
+}
+
+func (d *dockerRuntime) ContainerWait(ctx context.Context, id string) (int64, error) {
+	return d.cli.ContainerWait(ctx, id)
+}
+
+func (d *dockerRuntime) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	return d.cli.ContainerInspect(ctx, id)
+}
+
+func (d *dockerRuntime) ContainerRemove(ctx context.Context, id string, opts types.ContainerRemoveOptions) error {
+	return d.cli.ContainerRemove(ctx, id, opts)
+}
+
+func (d *dockerRuntime) ContainerLogs(ctx context.Context, id string) (string, error) {
+	reader, err := d.cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	buf := new(bytes.Buffer)
+	// Each output line has a header, which needs to be removed
+	if _, err := stdcopy.StdCopy(buf, buf, reader); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ContainerExec runs a command in a running container, and returns the exit
+// code and combined stdout/stderr output.
+func (d *dockerRuntime) ContainerExec(ctx context.Context, id string, user string, cmd []string) (int, string, error) {
+rerun:
+	config := types.ExecConfig{
+		User:         user,
+		Privileged:   false,
+		Tty:          false,
+		AttachStdin:  false,
+		AttachStdout: true,
+		AttachStderr: true,
+		Detach:       false,
+		Cmd:          cmd,
+	}
+	resp, err := d.cli.ContainerExecCreate(ctx, id, config)
+	if err != nil {
+		return 0, "", err
+	}
+	hijack, err := d.cli.ContainerExecAttach(ctx, resp.ID, config)
+	if err != nil {
+		return 0, "", err
+	}
+	d.cli.ContainerExecStart(ctx, resp.ID, types.ExecStartCheck{
+		Detach: false,
+		Tty:    false,
+	})
+	// Wait for the command to finish
+	var exitcode int
+	for {
+		inspect, err := d.cli.ContainerExecInspect(ctx, resp.ID)
+		if err != nil {
+			return 0, "", err
+		}
+		if !inspect.Running {
+			exitcode = inspect.ExitCode
+			break
+		}
+	}
+	buf := new(bytes.Buffer)
+	// Each output line has a header, which needs to be removed
+	_, err = stdcopy.StdCopy(buf, buf, hijack.Reader)
+	if err != nil {
+		return 0, "", err
+	}
+
+	outputStr := strings.TrimSpace(buf.String())
+
+	// Before we go let's just double check it did actually run because
+	// sometimes we get a "Exec command already running error"
+	alreadyRunningErr := regexp.MustCompile("Error: Exec command .* is already running")
+	if alreadyRunningErr.MatchString(outputStr) {
+		time.Sleep(1 * time.Second)
+		goto rerun
+	}
+
+	return exitcode, outputStr, nil
+}
+
+func (d *dockerRuntime) CopyFromContainer(ctx context.Context, id string, srcPath string) (io.ReadCloser, error) {
+	reader, _, err := d.cli.CopyFromContainer(ctx, id, srcPath)
+	return reader, err
+}
+
+func (d *dockerRuntime) ImageBuild(ctx context.Context, buildContext io.Reader, tag string) error {
+	buildOptions := types.ImageBuildOptions{
+		Context: buildContext,
+		Tags:    []string{tag},
+	}
+	resp, err := d.cli.ImageBuild(ctx, buildContext, buildOptions)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeJSONMessageStream(resp.Body, log.Printf)
+}
+
+func (d *dockerRuntime) ImageRemove(ctx context.Context, id string) error {
+	_, err := d.cli.ImageRemove(ctx, id, types.ImageRemoveOptions{Force: true})
+	return err
+}
+
+func (d *dockerRuntime) ImagePull(ctx context.Context, ref string, auth string) error {
+	reader, err := d.cli.ImagePull(ctx, ref, types.ImagePullOptions{
+		RegistryAuth: auth,
+	})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return decodeJSONMessageStream(reader, log.Printf)
+}
+
+func (d *dockerRuntime) ImageTag(ctx context.Context, source string, target string) error {
+	return d.cli.ImageTag(ctx, source, target)
+}
+
+func (d *dockerRuntime) NetworkCreate(ctx context.Context, name string) (string, error) {
+	net, err := d.cli.NetworkCreate(ctx, name, types.NetworkCreate{})
+	if err != nil {
+		return "", err
+	}
+	return net.ID, nil
+}
+
+func (d *dockerRuntime) NetworkRemove(ctx context.Context, id string) error {
+	return d.cli.NetworkRemove(ctx, id)
+}
+
+func (d *dockerRuntime) VolumeCreate(ctx context.Context, name string) error {
+	_, err := d.cli.VolumeCreate(ctx, volume.VolumesCreateBody{
+		Driver: "local",
+		Labels: map[string]string{},
+		Name:   name,
+	})
+	return err
+}
+
+func (d *dockerRuntime) VolumeRemove(ctx context.Context, name string) error {
+	return d.cli.VolumeRemove(ctx, name, true)
+}
+
+// decodeJSONMessageStream reads a stream of Docker JSON progress messages,
+// as returned by ImageBuild and ImagePull, logging each one via logf and
+// failing on the first error message encountered.
+func decodeJSONMessageStream(r io.Reader, logf func(format string, args ...interface{})) error {
+	dec := json.NewDecoder(r)
+	for {
+		m := jsonmessage.JSONMessage{}
+		err := dec.Decode(&m)
+		if m.Error != nil {
+			return errors.New(m.ErrorMessage)
+		}
+		if line := strings.TrimSpace(m.Stream); line != "" {
+			logf("%s", line)
+		} else if line := strings.TrimSpace(m.Status); line != "" {
+			if m.Progress != nil {
+				logf("%s %s", line, m.Progress.String())
+			} else {
+				logf("%s", line)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
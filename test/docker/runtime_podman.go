@@ -0,0 +1,297 @@
+/*
+© Copyright IBM Corporation 2017, 2018
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// podmanRuntime implements Runtime by shelling out to the podman CLI.
+// Podman's REST API is socket-activated and not reliably available in
+// rootless CI environments, whereas the `podman` binary always is, so the
+// CLI is the more portable integration point here.
+type podmanRuntime struct {
+	bin string
+}
+
+func newPodmanRuntime() (Runtime, error) {
+	bin, err := exec.LookPath("podman")
+	if err != nil {
+		return nil, fmt.Errorf("TEST_RUNTIME=podman requires the podman binary to be on PATH: %v", err)
+	}
+	return &podmanRuntime{bin: bin}, nil
+}
+
+func (p *podmanRuntime) run(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, p.bin, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("podman %v: %v: %s", args, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (p *podmanRuntime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (string, error) {
+	args := []string{"create", "--name", containerName}
+	for _, b := range hostConfig.Binds {
+		args = append(args, "-v", b)
+	}
+	for ctrPort, bindings := range hostConfig.PortBindings {
+		for _, binding := range bindings {
+			args = append(args, "-p", fmt.Sprintf("%s:%s", binding.HostPort, ctrPort.Port()))
+		}
+	}
+	for _, e := range config.Env {
+		args = append(args, "-e", e)
+	}
+	if len(config.Entrypoint) > 0 {
+		// podman's --entrypoint takes either a single executable or a
+		// JSON array; space-joining a multi-element entrypoint would
+		// collapse it into one (non-existent) executable name.
+		entrypoint, err := json.Marshal([]string(config.Entrypoint))
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--entrypoint", string(entrypoint))
+	}
+	args = append(args, config.Image)
+	args = append(args, config.Cmd...)
+	return p.run(ctx, args...)
+}
+
+func (p *podmanRuntime) ContainerStart(ctx context.Context, id string) error {
+	_, err := p.run(ctx, "start", id)
+	return err
+}
+
+func (p *podmanRuntime) ContainerStop(ctx context.Context, id string, timeout *time.Duration) error {
+	args := []string{"stop"}
+	if timeout != nil {
+		args = append(args, "-t", strconv.Itoa(int(timeout.Seconds())))
+	}
+	args = append(args, id)
+	_, err := p.run(ctx, args...)
+	return err
+}
+
+func (p *podmanRuntime) ContainerWait(ctx context.Context, id string) (int64, error) {
+	out, err := p.run(ctx, "wait", id)
+	if err != nil {
+		return -1, err
+	}
+	rc, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return -1, err
+	}
+	return rc, nil
+}
+
+func (p *podmanRuntime) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	var result types.ContainerJSON
+	out, err := p.run(ctx, "inspect", "--type", "container", id)
+	if err != nil {
+		return result, err
+	}
+	var raw []types.ContainerJSON
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		return result, err
+	}
+	if len(raw) == 0 {
+		return result, fmt.Errorf("no inspect data returned for container %v", id)
+	}
+	return raw[0], nil
+}
+
+func (p *podmanRuntime) ContainerRemove(ctx context.Context, id string, opts types.ContainerRemoveOptions) error {
+	args := []string{"rm"}
+	if opts.Force {
+		args = append(args, "-f")
+	}
+	if opts.RemoveVolumes {
+		args = append(args, "-v")
+	}
+	args = append(args, id)
+	_, err := p.run(ctx, args...)
+	return err
+}
+
+func (p *podmanRuntime) ContainerLogs(ctx context.Context, id string) (string, error) {
+	return p.run(ctx, "logs", id)
+}
+
+func (p *podmanRuntime) ContainerExec(ctx context.Context, id string, user string, cmd []string) (int, string, error) {
+	args := []string{"exec"}
+	if user != "" {
+		args = append(args, "-u", user)
+	}
+	args = append(args, id)
+	args = append(args, cmd...)
+
+	run := exec.CommandContext(ctx, p.bin, args...)
+	var out bytes.Buffer
+	run.Stdout = &out
+	run.Stderr = &out
+	err := run.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), strings.TrimSpace(out.String()), nil
+	}
+	if err != nil {
+		return -1, strings.TrimSpace(out.String()), err
+	}
+	return 0, strings.TrimSpace(out.String()), nil
+}
+
+func (p *podmanRuntime) CopyFromContainer(ctx context.Context, id string, srcPath string) (io.ReadCloser, error) {
+	tmp, err := ioutil.TempFile("", "podman-cp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+	if _, err := p.run(ctx, "cp", id+":"+srcPath, tmp.Name()); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (p *podmanRuntime) ImageBuild(ctx context.Context, buildContext io.Reader, tag string) error {
+	dir, err := ioutil.TempDir("", "podman-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := extractTar(buildContext, dir); err != nil {
+		return err
+	}
+	_, err = p.run(ctx, "build", "-t", tag, dir)
+	return err
+}
+
+func (p *podmanRuntime) ImageRemove(ctx context.Context, id string) error {
+	_, err := p.run(ctx, "rmi", "-f", id)
+	return err
+}
+
+func (p *podmanRuntime) ImagePull(ctx context.Context, ref string, auth string) error {
+	args := []string{"pull"}
+	if auth != "" {
+		creds, err := decodeRegistryAuth(auth)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--creds", creds)
+	}
+	args = append(args, ref)
+	_, err := p.run(ctx, args...)
+	return err
+}
+
+func (p *podmanRuntime) ImageTag(ctx context.Context, source string, target string) error {
+	_, err := p.run(ctx, "tag", source, target)
+	return err
+}
+
+// decodeRegistryAuth turns the base64-encoded Docker AuthConfig JSON
+// produced by registryAuth() into the "user:password" form podman's
+// --creds flag expects.
+func decodeRegistryAuth(auth string) (string, error) {
+	b, err := base64.URLEncoding.DecodeString(auth)
+	if err != nil {
+		return "", fmt.Errorf("decoding registry auth: %v", err)
+	}
+	var authConfig types.AuthConfig
+	if err := json.Unmarshal(b, &authConfig); err != nil {
+		return "", fmt.Errorf("decoding registry auth: %v", err)
+	}
+	return authConfig.Username + ":" + authConfig.Password, nil
+}
+
+func (p *podmanRuntime) NetworkCreate(ctx context.Context, name string) (string, error) {
+	return p.run(ctx, "network", "create", name)
+}
+
+func (p *podmanRuntime) NetworkRemove(ctx context.Context, id string) error {
+	_, err := p.run(ctx, "network", "rm", id)
+	return err
+}
+
+func (p *podmanRuntime) VolumeCreate(ctx context.Context, name string) error {
+	_, err := p.run(ctx, "volume", "create", name)
+	return err
+}
+
+func (p *podmanRuntime) VolumeRemove(ctx context.Context, name string) error {
+	_, err := p.run(ctx, "volume", "rm", "-f", name)
+	return err
+}
+
+// extractTar unpacks a TAR-formatted build context, as generated by
+// generateTAR, into dir so that it can be handed to `podman build`.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, hdr.Name)
+		if hdr.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(hdr.Mode))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		f.Close()
+	}
+}
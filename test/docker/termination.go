@@ -0,0 +1,73 @@
+/*
+© Copyright IBM Corporation 2017, 2018
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// TerminationMessage is the structured payload a container can write to
+// /dev/termination-log to describe why it exited, following the same
+// convention Kubernetes containers commonly use.
+type TerminationMessage struct {
+	Reason  string
+	Message string
+	MQRC    int
+	Time    time.Time
+	Details map[string]string
+}
+
+// readTerminationMessage reads and decodes the termination log for the
+// current test. If the file doesn't contain a JSON payload, it falls back
+// to treating the whole file as a plain-text Message.
+func readTerminationMessage(t *testing.T) (*TerminationMessage, error) {
+	b, err := ioutil.ReadFile(terminationLog(t))
+	if err != nil {
+		return nil, err
+	}
+	m := TerminationMessage{}
+	if err := json.Unmarshal(b, &m); err == nil {
+		return &m, nil
+	}
+	return &TerminationMessage{Message: string(b)}, nil
+}
+
+// expectTerminationReason fails t if the termination message's Reason
+// doesn't match reason.
+func expectTerminationReason(t *testing.T, reason string) {
+	m, err := readTerminationMessage(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Reason != reason {
+		t.Errorf("Expected termination reason %q, got %q (message: %v)", reason, m.Reason, m.Message)
+	}
+}
+
+// expectTerminationMQRC fails t if the termination message's MQRC doesn't
+// match rc.
+func expectTerminationMQRC(t *testing.T, rc int) {
+	m, err := readTerminationMessage(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MQRC != rc {
+		t.Errorf("Expected termination MQRC %v, got %v (message: %v)", rc, m.MQRC, m.Message)
+	}
+}